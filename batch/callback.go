@@ -0,0 +1,178 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// callbackSecretEnv names the environment variable holding the HMAC
+// secret used to sign webhook callback payloads.
+const callbackSecretEnv = "BATCH_CALLBACK_HMAC_SECRET"
+
+// callbackClient dials every callback itself (via safeDialContext)
+// rather than trusting ValidateCallbackURL's earlier net.LookupIP, and
+// refuses to follow redirects - otherwise a callback URL that passes
+// validation could still reach an internal address, either because it
+// resolves differently by the time the client actually connects (DNS
+// rebinding) or because its server 302s the client somewhere else
+// entirely.
+var callbackClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: safeDialContext,
+	},
+	CheckRedirect: refuseCallbackRedirect,
+}
+
+// safeDialContext resolves addr's host itself and dials whichever
+// resolved IP passes isPubliclyRoutable, instead of letting the
+// transport's default dialer do its own independent resolution at
+// connect time. That's what actually pins the connection to an address
+// this process checked - ValidateCallbackURL's earlier check is no
+// protection on its own, since a rebinding DNS record can return a
+// public IP there and a private one moments later at dial time.
+func safeDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	var lastErr error
+	for _, ip := range ips {
+		if !isPubliclyRoutable(ip) {
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("no publicly routable address found for %s", host)
+}
+
+// refuseCallbackRedirect stops callbackClient from transparently
+// following redirects: the request URL it was given already went
+// through ValidateCallbackURL, but a redirect target hasn't (only
+// safeDialContext would still check where it connects), so a callback
+// is only ever delivered to the URL that was validated.
+func refuseCallbackRedirect(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// validCallbackSchemes restricts webhook callbacks to plain HTTP(S).
+var validCallbackSchemes = map[string]bool{"http": true, "https": true}
+
+// ValidateCallbackURL rejects callback URLs that aren't safe for this
+// server to dial on a caller's behalf: non-http(s) schemes, and hosts
+// that resolve to loopback, private, link-local, or other non-public
+// addresses (including the 169.254.169.254 cloud metadata endpoint).
+// Called both when a batch request is accepted and again immediately
+// before PostCallback dials, so a callback URL that resolves differently
+// between the two (DNS rebinding) can't slip a callback through. An
+// empty rawURL is valid (it just means no callback was requested).
+func ValidateCallbackURL(rawURL string) error {
+	if rawURL == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid callback URL: %w", err)
+	}
+	if !validCallbackSchemes[parsed.Scheme] {
+		return fmt.Errorf("callback URL must use http or https")
+	}
+	host := parsed.Hostname()
+	if host == "" {
+		return fmt.Errorf("callback URL must include a host")
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fmt.Errorf("callback URL host could not be resolved: %w", err)
+	}
+	for _, ip := range ips {
+		if !isPubliclyRoutable(ip) {
+			return fmt.Errorf("callback URL must resolve to a public address")
+		}
+	}
+	return nil
+}
+
+// isPubliclyRoutable reports whether ip is safe for this server to dial
+// on a caller's behalf, i.e. not loopback, private, link-local
+// (including the 169.254.169.254 cloud metadata address), unspecified,
+// or multicast.
+func isPubliclyRoutable(ip net.IP) bool {
+	switch {
+	case ip.IsLoopback(), ip.IsPrivate(), ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast(),
+		ip.IsUnspecified(), ip.IsMulticast():
+		return false
+	default:
+		return true
+	}
+}
+
+// PostCallback POSTs the resolved item for jobID to url, signing the
+// body with HMAC-SHA256 under the X-Batch-Signature header so the
+// receiver can verify it came from this server. It's fire-and-forget:
+// failures (including url failing ValidateCallbackURL) are not retried
+// and do not affect the job's own state.
+func PostCallback(url, jobID string, item Item) {
+	if url == "" {
+		return
+	}
+	if err := ValidateCallbackURL(url); err != nil {
+		return
+	}
+
+	payload, err := json.Marshal(struct {
+		JobID string `json:"jobId"`
+		Item  Item   `json:"item"`
+	}{JobID: jobID, Item: item})
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := os.Getenv(callbackSecretEnv); secret != "" {
+		req.Header.Set("X-Batch-Signature", signHMAC(secret, payload))
+	}
+
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+// signHMAC returns the hex-encoded HMAC-SHA256 of payload under secret.
+func signHMAC(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,51 @@
+package batch
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestValidateCallbackURL(t *testing.T) {
+	cases := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{"empty is valid (no callback requested)", "", false},
+		{"non-http(s) scheme rejected", "ftp://93.184.216.34/cb", true},
+		{"missing host rejected", "http:///cb", true},
+		{"loopback rejected", "http://127.0.0.1/cb", true},
+		{"ipv6 loopback rejected", "http://[::1]/cb", true},
+		{"link-local metadata address rejected", "http://169.254.169.254/latest/meta-data", true},
+		{"private address rejected", "http://10.0.0.5/cb", true},
+		{"public address accepted", "http://93.184.216.34/cb", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateCallbackURL(c.url)
+			if (err != nil) != c.wantErr {
+				t.Errorf("ValidateCallbackURL(%q) error = %v, wantErr %v", c.url, err, c.wantErr)
+			}
+		})
+	}
+}
+
+// TestSafeDialContextRejectsNonPublicAddresses confirms safeDialContext
+// does its own isPubliclyRoutable check against whatever it resolves at
+// dial time, rather than trusting that the address already passed
+// ValidateCallbackURL earlier - that independent check is what actually
+// closes the DNS-rebinding window between the two.
+func TestSafeDialContextRejectsNonPublicAddresses(t *testing.T) {
+	_, err := safeDialContext(context.Background(), "tcp", "127.0.0.1:80")
+	if err == nil {
+		t.Fatal("safeDialContext dialed a loopback address, want an error")
+	}
+}
+
+func TestRefuseCallbackRedirect(t *testing.T) {
+	if err := refuseCallbackRedirect(&http.Request{}, nil); err != http.ErrUseLastResponse {
+		t.Errorf("refuseCallbackRedirect() = %v, want http.ErrUseLastResponse", err)
+	}
+}
@@ -0,0 +1,236 @@
+// Package batch implements in-memory tracking of asynchronous adventurer
+// search batches so callers can submit a large batch, get a jobId back
+// immediately, and poll (or receive webhook callbacks) for per-query
+// results as they complete.
+package batch
+
+import (
+	"sync"
+	"time"
+
+	"bdo-rest-api/models"
+)
+
+// Item statuses. These mirror the per-query statuses used by the
+// synchronous batch handler, plus "canceled" for jobs stopped early.
+const (
+	StatusPending  = "pending"
+	StatusStarted  = "started"
+	StatusCached   = "cached"
+	StatusDone     = "done"
+	StatusError    = "error"
+	StatusRejected = "rejected"
+	StatusInvalid  = "invalid"
+	StatusCanceled = "canceled"
+)
+
+// Item tracks the lifecycle of a single query within a Job. For
+// federated (multi-region) jobs, Regions holds one RegionResult per
+// region and Status is the aggregate across all of them; Data/Error are
+// left unset in that case.
+type Item struct {
+	Query      string           `json:"query"`
+	Status     string           `json:"status"`
+	HTTPStatus int              `json:"httpStatus"`
+	Data       []models.Profile `json:"data,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Regions    []RegionResult   `json:"regions,omitempty"`
+}
+
+// RegionResult is a single region's outcome for one query within a
+// federated batch.
+type RegionResult struct {
+	Region     string           `json:"region"`
+	Status     string           `json:"status"`
+	HTTPStatus int              `json:"httpStatus"`
+	Data       []models.Profile `json:"data,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// Job is a single submitted batch and the current status of every query
+// within it. All access goes through the methods below, which hold the
+// mutex, so a *Job is safe to share across the HTTP handler goroutine
+// and whatever goroutines resolve its items.
+type Job struct {
+	ID          string
+	Region      string
+	SearchType  string
+	CallbackURL string
+
+	mu              sync.Mutex
+	items           []*Item
+	expectedRegions int
+	canceled        bool
+	createdAt       time.Time
+	expiresAt       time.Time
+}
+
+// newJob builds a Job with one pending Item per query, in submission
+// order. It is unexported; callers go through Store.Create so every Job
+// is registered for TTL eviction. expectedRegions is how many regions
+// each item's UpdateRegion calls will eventually report for - 1 for a
+// single-region job, more for a federated one - so aggregateRegionStatus
+// knows not to report an item done until every one of them has reported.
+func newJob(id, region, searchType, callbackURL string, queries []string, expectedRegions int, ttl time.Duration) *Job {
+	items := make([]*Item, len(queries))
+	for i, q := range queries {
+		items[i] = &Item{Query: q, Status: StatusPending}
+	}
+	now := time.Now()
+	return &Job{
+		ID:              id,
+		Region:          region,
+		SearchType:      searchType,
+		CallbackURL:     callbackURL,
+		items:           items,
+		expectedRegions: expectedRegions,
+		createdAt:       now,
+		expiresAt:       now.Add(ttl),
+	}
+}
+
+// Update sets the status/data/error for the item at index i. Updates
+// after the job has been canceled are ignored so a late scraper result
+// can't resurrect a canceled job.
+func (j *Job) Update(i int, item Item) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.canceled || i < 0 || i >= len(j.items) {
+		return
+	}
+	j.items[i] = &item
+}
+
+// UpdateRegion merges a single region's result into item i's Regions
+// slice (replacing any earlier result for that region) and recomputes
+// the item's aggregate Status. Federated (multi-region) batches use
+// this instead of Update, which federated code leaves untouched.
+func (j *Job) UpdateRegion(i int, result RegionResult) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.canceled || i < 0 || i >= len(j.items) {
+		return
+	}
+
+	item := j.items[i]
+	replaced := false
+	for ri, existing := range item.Regions {
+		if existing.Region == result.Region {
+			item.Regions[ri] = result
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		item.Regions = append(item.Regions, result)
+	}
+	item.Status = aggregateRegionStatus(item.Regions, j.expectedRegions)
+}
+
+// aggregateRegionStatus rolls up a query's per-region results into a
+// single status: pending/started while any region hasn't finished, or
+// while fewer than expected regions have reported at all; canceled if
+// every region that finished was canceled and none succeeded; error if
+// every region that finished failed; done otherwise.
+func aggregateRegionStatus(regions []RegionResult, expected int) string {
+	terminal, started, errored, canceled, succeeded := len(regions) >= expected, false, false, false, false
+	for _, r := range regions {
+		switch r.Status {
+		case StatusPending:
+			terminal = false
+		case StatusStarted:
+			terminal = false
+			started = true
+		case StatusCanceled:
+			canceled = true
+		case StatusError, StatusRejected, StatusInvalid:
+			errored = true
+		default:
+			succeeded = true
+		}
+	}
+	if !terminal {
+		if started {
+			return StatusStarted
+		}
+		return StatusPending
+	}
+	if canceled && !succeeded && !errored {
+		return StatusCanceled
+	}
+	if errored && !succeeded {
+		return StatusError
+	}
+	return StatusDone
+}
+
+// ItemAt returns a copy of item i's current state, e.g. for posting to
+// a webhook callback without holding the job's lock.
+func (j *Job) ItemAt(i int) Item {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if i < 0 || i >= len(j.items) {
+		return Item{}
+	}
+	return *j.items[i]
+}
+
+// Cancel marks every item that hasn't reached a terminal status as
+// canceled and stops further Update calls from taking effect. It
+// reports whether anything was actually canceled.
+func (j *Job) Cancel() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	changed := !j.canceled
+	j.canceled = true
+	for _, item := range j.items {
+		if item.Status == StatusPending || item.Status == StatusStarted {
+			item.Status = StatusCanceled
+			item.HTTPStatus = 0
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Snapshot returns a copy of the job's current items and a fresh stats
+// tally, safe to serialize without holding the job's lock.
+func (j *Job) Snapshot() ([]Item, map[string]int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	items := make([]Item, len(j.items))
+	stats := map[string]int{
+		StatusPending:  0,
+		StatusStarted:  0,
+		StatusCached:   0,
+		StatusDone:     0,
+		StatusError:    0,
+		StatusRejected: 0,
+		StatusInvalid:  0,
+		StatusCanceled: 0,
+	}
+	for i, item := range j.items {
+		items[i] = *item
+		stats[item.Status]++
+	}
+	return items, stats
+}
+
+// Done reports whether every item in the job has reached a terminal
+// status (anything other than pending/started).
+func (j *Job) Done() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, item := range j.items {
+		if item.Status == StatusPending || item.Status == StatusStarted {
+			return false
+		}
+	}
+	return true
+}
+
+// expired reports whether the job's TTL has elapsed as of now.
+func (j *Job) expired(now time.Time) bool {
+	return now.After(j.expiresAt)
+}
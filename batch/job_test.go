@@ -0,0 +1,73 @@
+package batch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAggregateRegionStatus(t *testing.T) {
+	cases := []struct {
+		name     string
+		regions  []RegionResult
+		expected int
+		want     string
+	}{
+		{"no regions reported yet", nil, 2, StatusPending},
+		{"one of two reported", []RegionResult{{Region: "na", Status: StatusDone}}, 2, StatusPending},
+		{"one of two still started", []RegionResult{{Region: "na", Status: StatusStarted}}, 2, StatusStarted},
+		{"all done", []RegionResult{{Region: "na", Status: StatusDone}, {Region: "eu", Status: StatusDone}}, 2, StatusDone},
+		{"all error", []RegionResult{{Region: "na", Status: StatusError}, {Region: "eu", Status: StatusError}}, 2, StatusError},
+		{"mixed done and error counts as done", []RegionResult{{Region: "na", Status: StatusDone}, {Region: "eu", Status: StatusError}}, 2, StatusDone},
+		{"all canceled", []RegionResult{{Region: "na", Status: StatusCanceled}, {Region: "eu", Status: StatusCanceled}}, 2, StatusCanceled},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := aggregateRegionStatus(c.regions, c.expected)
+			if got != c.want {
+				t.Errorf("aggregateRegionStatus(%+v, %d) = %q, want %q", c.regions, c.expected, got, c.want)
+			}
+		})
+	}
+}
+
+func TestJobUpdateRegionWaitsForEveryRegion(t *testing.T) {
+	job := newJob("job-1", "na,eu", "1", "", []string{"Tarka"}, 2, time.Minute)
+
+	job.UpdateRegion(0, RegionResult{Region: "na", Status: StatusDone})
+	if got := job.ItemAt(0).Status; got != StatusPending {
+		t.Fatalf("status after 1 of 2 regions reported = %q, want %q", got, StatusPending)
+	}
+
+	job.UpdateRegion(0, RegionResult{Region: "eu", Status: StatusDone})
+	if got := job.ItemAt(0).Status; got != StatusDone {
+		t.Fatalf("status after both regions reported = %q, want %q", got, StatusDone)
+	}
+	if !job.Done() {
+		t.Fatal("job.Done() = false once every item has reached a terminal status")
+	}
+}
+
+func TestJobCancelStopsPendingItemsAndFurtherUpdates(t *testing.T) {
+	job := newJob("job-2", "na", "1", "", []string{"Tarka", "Orwen"}, 1, time.Minute)
+	job.Update(0, Item{Query: "Tarka", Status: StatusStarted})
+
+	if !job.Cancel() {
+		t.Fatal("Cancel() = false on a job with pending/started items, want true")
+	}
+	if got := job.ItemAt(0).Status; got != StatusCanceled {
+		t.Errorf("item 0 status after Cancel = %q, want %q", got, StatusCanceled)
+	}
+	if got := job.ItemAt(1).Status; got != StatusCanceled {
+		t.Errorf("item 1 status after Cancel = %q, want %q", got, StatusCanceled)
+	}
+
+	job.Update(0, Item{Query: "Tarka", Status: StatusDone})
+	if got := job.ItemAt(0).Status; got != StatusCanceled {
+		t.Errorf("Update after Cancel should be a no-op, got status %q", got)
+	}
+
+	if job.Cancel() {
+		t.Error("Cancel() = true on an already-canceled job, want false")
+	}
+}
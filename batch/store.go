@@ -0,0 +1,89 @@
+package batch
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is how long a job's state is kept around for polling,
+// counted from when the job was created (whether or not it has
+// completed), before it's evicted.
+const DefaultTTL = 15 * time.Minute
+
+// Jobs is the process-wide job store, following the same package-level
+// singleton pattern as cache.ProfileSearch.
+var Jobs = NewStore(DefaultTTL)
+
+// Store is an in-memory, TTL-evicting registry of batch Jobs.
+type Store struct {
+	ttl time.Duration
+
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+// NewStore creates a Store and starts its background eviction loop.
+func NewStore(ttl time.Duration) *Store {
+	s := &Store{
+		ttl:  ttl,
+		jobs: make(map[string]*Job),
+	}
+	go s.evictLoop()
+	return s
+}
+
+// Create registers a new job for the given queries and returns it.
+// regionCount is how many regions the batch fans each query out across
+// (1 for a single-region batch), passed through so per-item status
+// aggregation knows how many RegionResults to wait for.
+func (s *Store) Create(region, searchType, callbackURL string, queries []string, regionCount int) *Job {
+	job := newJob(newJobID(), region, searchType, callbackURL, queries, regionCount, s.ttl)
+
+	s.mu.Lock()
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+
+	return job
+}
+
+// Get looks up a job by id. The bool is false if the job doesn't exist
+// or has already been evicted.
+func (s *Store) Get(id string) (*Job, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	return job, ok
+}
+
+// Delete removes a job from the store outright.
+func (s *Store) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+}
+
+// evictLoop periodically drops jobs whose TTL has elapsed.
+func (s *Store) evictLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.mu.Lock()
+		for id, job := range s.jobs {
+			if job.expired(now) {
+				delete(s.jobs, id)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// newJobID generates a random, URL-safe job identifier.
+func newJobID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return hex.EncodeToString([]byte(time.Now().String()))
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,32 @@
+// Command openapigen writes the handlers package's generated OpenAPI
+// document to openapi.json at the repo root, so it can be committed and
+// served as a static file in addition to the live /openapi.json route.
+// It's only ever meant to be invoked via handlers' go:generate directive
+// (`go generate ./handlers/...`, or `go generate` from within handlers/),
+// which fixes its working directory to the handlers package - hence the
+// "../openapi.json" below. Run any other way (e.g. `go run` from the
+// repo root), it would write one directory up from wherever it's run.
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"bdo-rest-api/handlers"
+)
+
+const outputPath = "../openapi.json"
+
+func main() {
+	document := handlers.GenerateOpenAPIDocument()
+
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		log.Fatalf("openapigen: marshal document: %v", err)
+	}
+
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		log.Fatalf("openapigen: write %s: %v", outputPath, err)
+	}
+}
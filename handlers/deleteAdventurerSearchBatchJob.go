@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"bdo-rest-api/batch"
+	"bdo-rest-api/openapi"
+)
+
+type deleteAdventurerSearchBatchJobResponse struct {
+	JobID    string `json:"jobId"`
+	Canceled bool   `json:"canceled"`
+}
+
+// deleteAdventurerSearchBatchJobRoute is this handler's OpenAPI route
+// declaration; see adventurerSearchBatchRoute for why it lives here
+// rather than in a central list.
+var deleteAdventurerSearchBatchJobRoute = openapi.Route{
+	Method:       http.MethodDelete,
+	Path:         "/adventurer/search/batch/{jobId}",
+	Summary:      "Cancel a batch job's still-pending queries",
+	ResponseType: reflect.TypeOf(deleteAdventurerSearchBatchJobResponse{}),
+}
+
+// deleteAdventurerSearchBatchJob cancels any still-pending/started
+// queries in a batch job. Queries that already resolved (cached, done,
+// error, etc.) are left untouched.
+func deleteAdventurerSearchBatchJob(w http.ResponseWriter, r *http.Request) {
+	jobID := r.PathValue("jobId")
+
+	job, ok := batch.Jobs.Get(jobID)
+	if !ok {
+		giveNotFoundResponse(w, "No batch job found with that id.")
+		return
+	}
+
+	canceled := job.Cancel()
+	json.NewEncoder(w).Encode(deleteAdventurerSearchBatchJobResponse{
+		JobID:    job.ID,
+		Canceled: canceled,
+	})
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"bdo-rest-api/batch"
+	"bdo-rest-api/cache"
+	"bdo-rest-api/models"
+	"bdo-rest-api/scraper"
+	"bdo-rest-api/validators"
+)
+
+// federatedPoolSize bounds how many (query, region) pairs a federated
+// batch request dispatches concurrently.
+const federatedPoolSize = 8
+
+// resolveBatchRegions expands an adventurerSearchBatchRequest's region
+// selection into a deduplicated list of valid region codes. regions
+// takes precedence over region when both are set; region == "all" fans
+// out to every region the API knows about.
+func resolveBatchRegions(region string, regions []string) ([]string, bool, string) {
+	var candidates []string
+	switch {
+	case len(regions) > 0:
+		candidates = regions
+	case region == "all":
+		candidates = validators.AllRegions()
+	default:
+		candidates = []string{region}
+	}
+
+	resolved := make([]string, 0, len(candidates))
+	seen := make(map[string]bool, len(candidates))
+	for _, candidate := range candidates {
+		validated, ok, validationMessage := validators.ValidateRegionQueryParam([]string{candidate})
+		if !ok {
+			return nil, false, validationMessage
+		}
+		if seen[validated] {
+			continue
+		}
+		seen[validated] = true
+		resolved = append(resolved, validated)
+	}
+
+	return resolved, true, ""
+}
+
+// splitRegionsInMaintenance partitions regions into those currently
+// live and those under maintenance, using giveMaintenanceResponse
+// against a discarded response recorder so the check can run per
+// region without writing to the real response. If every region is
+// under maintenance, the real maintenance response is written to w and
+// live comes back empty.
+func splitRegionsInMaintenance(w http.ResponseWriter, regions []string) (live, maintenance []string) {
+	for _, region := range regions {
+		if giveMaintenanceResponse(httptest.NewRecorder(), region) {
+			maintenance = append(maintenance, region)
+			continue
+		}
+		live = append(live, region)
+	}
+
+	if len(live) == 0 {
+		giveMaintenanceResponse(w, regions[0])
+	}
+
+	return live, maintenance
+}
+
+// federatedBatchHandler fans a batch of queries out across multiple
+// regions in parallel, merging each query's per-region outcome into a
+// single adventurerSearchBatchItem.
+type federatedBatchHandler struct {
+	job         *batch.Job
+	ctx         context.Context
+	queries     []string
+	regions     []string
+	searchType  string
+	bypassCache bool
+	clientIP    string
+	callbackURL string
+	limit       int
+	offset      int
+	onItem      func(adventurerSearchBatchItem)
+
+	mu            sync.Mutex
+	items         []adventurerSearchBatchItem
+	statsByRegion map[string]map[string]int
+	regionErrors  map[string]string
+}
+
+// newFederatedBatchHandler builds a handler for fanning queries out
+// across regions. onItem, if non-nil, is called every time a query's
+// aggregate item changes (i.e. every time one of its regions is
+// recorded, including as started/pending) -
+// used to stream progress; pass nil to just collect the final result
+// from run().
+func newFederatedBatchHandler(ctx context.Context, job *batch.Job, queries, regions []string, searchType string, bypassCache bool, clientIP, callbackURL string, limit, offset int, onItem func(adventurerSearchBatchItem)) *federatedBatchHandler {
+	items := make([]adventurerSearchBatchItem, len(queries))
+	for i, query := range queries {
+		items[i] = adventurerSearchBatchItem{Query: query}
+	}
+
+	statsByRegion := make(map[string]map[string]int, len(regions))
+	for _, region := range regions {
+		statsByRegion[region] = map[string]int{}
+	}
+
+	return &federatedBatchHandler{
+		job:           job,
+		ctx:           ctx,
+		queries:       queries,
+		regions:       regions,
+		searchType:    searchType,
+		bypassCache:   bypassCache,
+		clientIP:      clientIP,
+		callbackURL:   callbackURL,
+		limit:         limit,
+		offset:        offset,
+		onItem:        onItem,
+		items:         items,
+		statsByRegion: statsByRegion,
+		regionErrors:  map[string]string{},
+	}
+}
+
+// run dispatches every (query, region) pair across a bounded worker
+// pool and waits for dispatch to finish. Queries that end up enqueued
+// against the scraper keep resolving asynchronously into h.job after
+// run returns, exactly as the single-region path does. If h.ctx is
+// canceled mid-dispatch, remaining pairs are marked canceled instead of
+// being dispatched.
+func (h *federatedBatchHandler) run() ([]adventurerSearchBatchItem, map[string]map[string]int, map[string]string) {
+	type dispatch struct {
+		queryIndex int
+		region     string
+	}
+
+	work := make(chan dispatch)
+	var wg sync.WaitGroup
+	for n := 0; n < federatedPoolSize; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range work {
+				h.resolveOne(d.queryIndex, d.region)
+			}
+		}()
+	}
+
+	for queryIndex := range h.queries {
+		for _, region := range h.regions {
+			if h.ctx != nil && h.ctx.Err() != nil {
+				h.record(queryIndex, batch.RegionResult{Region: region, Status: batch.StatusCanceled})
+				continue
+			}
+			select {
+			case work <- dispatch{queryIndex: queryIndex, region: region}:
+			case <-contextDone(h.ctx):
+				h.record(queryIndex, batch.RegionResult{Region: region, Status: batch.StatusCanceled})
+			}
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.items, h.statsByRegion, h.regionErrors
+}
+
+// contextDone returns ctx.Done() if ctx is set, or a channel that never
+// fires otherwise, so callers can select on it unconditionally.
+func contextDone(ctx context.Context) <-chan struct{} {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Done()
+}
+
+// resolveOne validates, checks cache, and (if necessary) enqueues a
+// single query against a single region, recording the outcome into
+// both the handler's own collector and the shared batch.Job.
+func (h *federatedBatchHandler) resolveOne(queryIndex int, region string) {
+	query := h.queries[queryIndex]
+
+	name, queryOk, queryValidationMessage := validators.ValidateAdventurerNameQueryParam([]string{query}, region, h.searchType)
+	if !queryOk {
+		h.record(queryIndex, batch.RegionResult{
+			Region:     region,
+			Status:     "invalid",
+			HTTPStatus: http.StatusBadRequest,
+			Error:      queryValidationMessage,
+		})
+		return
+	}
+
+	if !h.bypassCache {
+		if data, status, _, _, ok := cache.ProfileSearch.GetRecord([]string{region, name, h.searchType}); ok {
+			result := batch.RegionResult{Region: region, HTTPStatus: status}
+			if status == http.StatusOK {
+				result.Status = "cached"
+				result.Data = applyResultWindow(data, h.offset, h.limit)
+			} else {
+				result.Status = "error"
+				result.Error = "cached non-200 response"
+			}
+			h.record(queryIndex, result)
+			return
+		}
+	}
+
+	jobID, callbackURL := h.job.ID, h.callbackURL
+	// The scraper has already windowed data by offset/limit (it needs
+	// limit/offset itself to know when to stop paging), so it isn't
+	// re-applied here.
+	ok, tasksExceeded, _ := scraper.EnqueueAdventurerSearchWithCallback(h.clientIP, region, name, h.searchType, h.limit, h.offset, func(data []models.Profile, status int, scrapeErr error) {
+		resolved := batch.RegionResult{Region: region, HTTPStatus: status}
+		if scrapeErr != nil {
+			resolved.Status = "error"
+			resolved.Error = scrapeErr.Error()
+		} else {
+			resolved.Status = "done"
+			resolved.Data = data
+		}
+		h.record(queryIndex, resolved)
+		batch.PostCallback(callbackURL, jobID, h.job.ItemAt(queryIndex))
+	})
+	if tasksExceeded {
+		h.record(queryIndex, batch.RegionResult{
+			Region:     region,
+			Status:     "rejected",
+			HTTPStatus: http.StatusTooManyRequests,
+			Error:      "You have exceeded the maximum number of concurrent tasks.",
+		})
+		return
+	}
+
+	h.record(queryIndex, batch.RegionResult{
+		Region:     region,
+		Status:     map[bool]string{true: "started", false: "pending"}[ok],
+		HTTPStatus: http.StatusAccepted,
+	})
+}
+
+// record merges a resolved region result into the handler's own item
+// collector and its per-region stats, mirrors it into h.job, copies the
+// job's aggregate status for the query into the item's Status, and (if
+// set) notifies h.onItem with a snapshot of the query's item so far.
+// Because a single (query, region) pair is recorded twice for any query
+// that ends up enqueued against the scraper - once synchronously with
+// started/pending, again later from the scraper's own callback - the
+// previous status's count is decremented before the new one is counted,
+// so statsByRegion reflects each pair's current status rather than
+// double-counting it.
+func (h *federatedBatchHandler) record(queryIndex int, result batch.RegionResult) {
+	h.mu.Lock()
+	item := &h.items[queryIndex]
+	previousStatus := ""
+	replaced := false
+	for i, existing := range item.Regions {
+		if existing.Region == result.Region {
+			previousStatus = existing.Status
+			item.Regions[i] = result
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		item.Regions = append(item.Regions, result)
+	}
+
+	regionStats, ok := h.statsByRegion[result.Region]
+	if !ok {
+		regionStats = map[string]int{}
+		h.statsByRegion[result.Region] = regionStats
+	}
+	if replaced {
+		regionStats[previousStatus]--
+	}
+	regionStats[result.Status]++
+
+	if result.Status == "error" || result.Status == "rejected" || result.Status == "invalid" {
+		h.regionErrors[result.Region] = result.Error
+	}
+
+	h.job.UpdateRegion(queryIndex, result)
+	item.Status = h.job.ItemAt(queryIndex).Status
+
+	snapshot := *item
+	snapshot.Regions = append([]batch.RegionResult(nil), item.Regions...)
+	h.mu.Unlock()
+
+	if h.onItem != nil {
+		h.onItem(snapshot)
+	}
+}
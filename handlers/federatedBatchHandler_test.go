@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"bdo-rest-api/batch"
+)
+
+// TestFederatedBatchHandlerRecordDoesNotDoubleCountStats covers the same
+// (query, region) pair being recorded twice - once started, once
+// resolved - which is exactly what happens for any query that ends up
+// enqueued against the scraper. Before the fix, both calls incremented
+// statsByRegion unconditionally, so the "started" bucket was never
+// cleared out once the query resolved.
+func TestFederatedBatchHandlerRecordDoesNotDoubleCountStats(t *testing.T) {
+	job := batch.NewStore(time.Minute).Create("na,eu", "1", "", []string{"Tarka"}, 2)
+	h := newFederatedBatchHandler(nil, job, []string{"Tarka"}, []string{"na", "eu"}, "1", false, "", "", 0, 0, nil)
+
+	h.record(0, batch.RegionResult{Region: "na", Status: "started"})
+	if got := h.statsByRegion["na"]["started"]; got != 1 {
+		t.Fatalf("statsByRegion[na][started] = %d, want 1", got)
+	}
+
+	h.record(0, batch.RegionResult{Region: "na", Status: "done"})
+	if got := h.statsByRegion["na"]["started"]; got != 0 {
+		t.Errorf("statsByRegion[na][started] = %d after resolving, want 0 (stale bucket left uncleared)", got)
+	}
+	if got := h.statsByRegion["na"]["done"]; got != 1 {
+		t.Errorf("statsByRegion[na][done] = %d, want 1", got)
+	}
+}
@@ -1,39 +1,137 @@
 package handlers
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"net/http"
+	"reflect"
 	"strconv"
+	"strings"
 
+	"bdo-rest-api/batch"
 	"bdo-rest-api/cache"
 	"bdo-rest-api/models"
+	"bdo-rest-api/openapi"
 	"bdo-rest-api/scraper"
 	"bdo-rest-api/utils"
 	"bdo-rest-api/validators"
 )
 
 type adventurerSearchBatchRequest struct {
-	Region      string   `json:"region"`
-	SearchType  string   `json:"searchType"`
-	Queries     []string `json:"queries"`
-	BypassCache bool     `json:"bypassCache"`
+	Region      string   `json:"region" openapi:"description=Single region code; ignored if regions is set."`
+	Regions     []string `json:"regions" openapi:"description=Region codes to fan the batch out across; 'all' in region expands to every known region."`
+	SearchType  string   `json:"searchType" openapi:"description=1 for character name search, 2 for family name search."`
+	Queries     []string `json:"queries" openapi:"description=Adventurer/family names to search for.,maxItems=200"`
+	BypassCache bool     `json:"bypassCache" openapi:"description=Skip cached results; ignored unless the request carries a valid admin token."`
+	CallbackURL string   `json:"callbackUrl" openapi:"description=Webhook URL to POST each query's result to as it resolves."`
+	Limit       int      `json:"limit" openapi:"description=Max profiles per query; capped at 100."`
+	Offset      int      `json:"offset" openapi:"description=Profiles to skip before applying limit, per query."`
+	MaxResults  int      `json:"maxResults" openapi:"description=Truncates the results array to this many items and returns a nextCursor to resume."`
+	Cursor      string   `json:"cursor" openapi:"description=Opaque cursor from a previous response's nextCursor, to resume a paginated batch."`
 }
 
+// maxBatchResultLimit caps how many profiles a single query within a
+// batch can return, regardless of what Limit the caller asks for.
+const maxBatchResultLimit = 100
+
+// clampResultLimit normalizes a requested per-query Limit: 0 (or
+// negative) means unlimited, anything above maxBatchResultLimit is
+// capped to it.
+func clampResultLimit(limit int) int {
+	if limit <= 0 {
+		return 0
+	}
+	if limit > maxBatchResultLimit {
+		return maxBatchResultLimit
+	}
+	return limit
+}
+
+// applyResultWindow slices profiles by offset/limit, where limit == 0
+// means unlimited. Used both for cached hits and scraper results so
+// Limit/Offset behave the same regardless of where the data came from.
+func applyResultWindow(profiles []models.Profile, offset, limit int) []models.Profile {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(profiles) {
+		return []models.Profile{}
+	}
+	windowed := profiles[offset:]
+	if limit > 0 && limit < len(windowed) {
+		windowed = windowed[:limit]
+	}
+	return windowed
+}
+
+// encodeBatchCursor turns a starting index into req.Queries into the
+// opaque cursor token returned as nextCursor/X-Next-Cursor.
+func encodeBatchCursor(index int) string {
+	return base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(index)))
+}
+
+// decodeBatchCursor reverses encodeBatchCursor. An empty cursor decodes
+// to index 0 (start from the beginning).
+func decodeBatchCursor(cursor string) (int, bool) {
+	if cursor == "" {
+		return 0, true
+	}
+	raw, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	index, err := strconv.Atoi(string(raw))
+	if err != nil || index < 0 {
+		return 0, false
+	}
+	return index, true
+}
+
+// adventurerSearchBatchItem is a single query's outcome. Single-region
+// batches populate Status/HTTPStatus/Data/Error directly; federated
+// (multi-region) batches instead populate Regions and roll its
+// per-region statuses up into Status.
 type adventurerSearchBatchItem struct {
-	Query      string           `json:"query"`
-	Status     string           `json:"status"`
-	HTTPStatus int              `json:"httpStatus"`
-	Data       []models.Profile `json:"data,omitempty"`
-	Error      string           `json:"error,omitempty"`
+	Query      string               `json:"query" openapi:"description=The query string as submitted."`
+	Status     string               `json:"status" openapi:"description=One of pending/started/cached/done/error/rejected/invalid/canceled."`
+	HTTPStatus int                  `json:"httpStatus" openapi:"description=The HTTP status this query would have returned from the synchronous single-search endpoint."`
+	Data       []models.Profile     `json:"data,omitempty" openapi:"description=Matching profiles; only present once status is cached or done."`
+	Error      string               `json:"error,omitempty" openapi:"description=Human-readable failure reason; only present for error/rejected/invalid statuses."`
+	Regions    []batch.RegionResult `json:"regions,omitempty" openapi:"description=Per-region outcomes for a federated (multi-region) batch; omitted for single-region batches."`
 }
 
 type adventurerSearchBatchResponse struct {
-	Region     string                       `json:"region"`
-	SearchType string                       `json:"searchType"`
-	Results    []adventurerSearchBatchItem  `json:"results"`
-	Stats      map[string]int               `json:"stats"`
+	Region         string                      `json:"region,omitempty" openapi:"description=The single region searched; omitted when regions is set instead."`
+	Regions        []string                    `json:"regions,omitempty" openapi:"description=The regions searched, for a federated batch."`
+	SearchType     string                      `json:"searchType"`
+	JobID          string                      `json:"jobId" openapi:"description=Poll GET /adventurer/search/batch/{jobId} with this id for updates or DELETE it to cancel."`
+	Results        []adventurerSearchBatchItem `json:"results"`
+	Stats          map[string]int              `json:"stats" openapi:"description=Count by status of every submitted query (of every query/region pair for a federated batch) including any cut from results by maxResults; keyed by the same status values as results[].status."`
+	StatsByRegion  map[string]map[string]int   `json:"statsByRegion,omitempty" openapi:"description=Stats broken down per region for a federated batch."`
+	RegionErrors   map[string]string           `json:"regionErrors,omitempty" openapi:"description=Per-region failure reasons such as a region under maintenance."`
+	PartialSuccess bool                        `json:"partialSuccess,omitempty" openapi:"description=True if one or more requested regions could not be searched."`
+	NextCursor     string                      `json:"nextCursor,omitempty" openapi:"description=Pass back as cursor to resume a batch truncated by maxResults."`
+}
+
+// adventurerSearchBatchRoute is this handler's OpenAPI route declaration,
+// kept beside the handler it describes so changing this endpoint and
+// keeping its spec in sync happen in the same place (and the same
+// commit). handlers/openapi.go collects every handler's route into the
+// document it generates.
+var adventurerSearchBatchRoute = openapi.Route{
+	Method:       http.MethodPost,
+	Path:         "/adventurer/search/batch",
+	Summary:      "Submit a batch of adventurer searches across one or more regions",
+	RequestType:  reflect.TypeOf(adventurerSearchBatchRequest{}),
+	ResponseType: reflect.TypeOf(adventurerSearchBatchResponse{}),
 }
 
+// getAdventurerSearchBatch accepts a batch of queries, registers a
+// batch.Job for them, and returns 202 Accepted with a jobId as soon as
+// every query has at least been validated/cached/enqueued. Callers poll
+// GET /adventurer/search/batch/{jobId} (or supply callbackUrl) to learn
+// how queries that weren't served from cache resolve.
 func getAdventurerSearchBatch(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
 
@@ -43,7 +141,7 @@ func getAdventurerSearchBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	region, regionOk, regionValidationMessage := validators.ValidateRegionQueryParam([]string{req.Region})
+	regions, regionOk, regionValidationMessage := resolveBatchRegions(req.Region, req.Regions)
 	if !regionOk {
 		giveBadRequestResponse(w, regionValidationMessage)
 		return
@@ -61,11 +159,142 @@ func getAdventurerSearchBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if ok := giveMaintenanceResponse(w, region); ok {
+	if err := batch.ValidateCallbackURL(req.CallbackURL); err != nil {
+		giveBadRequestResponse(w, err.Error())
+		return
+	}
+
+	liveRegions, maintenanceRegions := splitRegionsInMaintenance(w, regions)
+	if len(liveRegions) == 0 {
 		return
 	}
 
-	results := make([]adventurerSearchBatchItem, 0, len(req.Queries))
+	bypassCache := req.BypassCache
+	if bypassCache && !utils.CheckAdminToken(r) {
+		bypassCache = false
+	}
+
+	cursorIndex, cursorOk := decodeBatchCursor(req.Cursor)
+	if !cursorOk {
+		giveBadRequestResponse(w, "Invalid cursor.")
+		return
+	}
+	queries := req.Queries
+	if cursorIndex > 0 {
+		if cursorIndex >= len(queries) {
+			queries = nil
+		} else {
+			queries = queries[cursorIndex:]
+		}
+	}
+
+	dispatch := &batchDispatch{
+		job:                batch.Jobs.Create(strings.Join(liveRegions, ","), searchType, req.CallbackURL, queries, len(liveRegions)),
+		queries:            queries,
+		regions:            regions,
+		liveRegions:        liveRegions,
+		maintenanceRegions: maintenanceRegions,
+		searchType:         searchType,
+		bypassCache:        bypassCache,
+		clientIP:           r.Header.Get("CF-Connecting-IP"),
+		callbackURL:        req.CallbackURL,
+		limit:              clampResultLimit(req.Limit),
+		offset:             req.Offset,
+	}
+
+	if wantsNDJSONBatchStream(r) {
+		streamAdventurerSearchBatch(w, r, dispatch)
+		return
+	}
+
+	results, stats, statsByRegion, regionErrors := dispatch.run(nil, nil)
+
+	truncated := false
+	nextCursor := ""
+	if req.MaxResults > 0 && len(results) > req.MaxResults {
+		results = results[:req.MaxResults]
+		truncated = true
+		nextCursor = encodeBatchCursor(cursorIndex + req.MaxResults)
+	}
+
+	response := adventurerSearchBatchResponse{
+		Regions:        regions,
+		SearchType:     map[string]string{"1": "characterName", "2": "familyName"}[searchType],
+		JobID:          dispatch.job.ID,
+		Results:        results,
+		Stats:          stats,
+		StatsByRegion:  statsByRegion,
+		RegionErrors:   regionErrors,
+		PartialSuccess: len(liveRegions) < len(regions),
+		NextCursor:     nextCursor,
+	}
+	if len(liveRegions) == 1 {
+		response.Region = liveRegions[0]
+		response.Regions = nil
+	}
+
+	w.Header().Set("X-Batch-Size", strconv.Itoa(len(queries)))
+	w.Header().Set("X-Batch-Truncated", strconv.FormatBool(truncated))
+	if truncated {
+		w.Header().Set("X-Next-Cursor", nextCursor)
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// batchDispatch bundles everything both the buffered and NDJSON
+// streaming response paths need once a batch request has passed
+// validation and its job has been registered.
+type batchDispatch struct {
+	job                *batch.Job
+	queries            []string
+	regions            []string
+	liveRegions        []string
+	maintenanceRegions []string
+	searchType         string
+	bypassCache        bool
+	clientIP           string
+	callbackURL        string
+	limit              int
+	offset             int
+}
+
+// run dispatches every query (fanning out across d.liveRegions when
+// there's more than one) and returns the resolved items plus stats. If
+// ctx is non-nil, dispatch aborts early once it's canceled. onItem, if
+// non-nil, is called as soon as each query resolves (for a federated
+// batch, every time one of a query's regions is recorded) - the
+// streaming path uses this to flush results as they come in.
+func (d *batchDispatch) run(ctx context.Context, onItem func(adventurerSearchBatchItem)) (results []adventurerSearchBatchItem, stats map[string]int, statsByRegion map[string]map[string]int, regionErrors map[string]string) {
+	regionErrors = make(map[string]string, len(d.maintenanceRegions))
+	for _, region := range d.maintenanceRegions {
+		regionErrors[region] = "region is under maintenance"
+	}
+
+	if len(d.liveRegions) == 1 {
+		results, stats = runSingleRegionBatch(ctx, d.job, d.queries, d.liveRegions[0], d.searchType, d.bypassCache, d.clientIP, d.callbackURL, d.limit, d.offset, onItem)
+		return results, stats, nil, regionErrors
+	}
+
+	handler := newFederatedBatchHandler(ctx, d.job, d.queries, d.liveRegions, d.searchType, d.bypassCache, d.clientIP, d.callbackURL, d.limit, d.offset, onItem)
+	var handlerRegionErrors map[string]string
+	results, statsByRegion, handlerRegionErrors = handler.run()
+	for region, message := range handlerRegionErrors {
+		regionErrors[region] = message
+	}
+	stats = aggregateStatsByRegion(statsByRegion)
+	return results, stats, statsByRegion, regionErrors
+}
+
+// runSingleRegionBatch is the original, non-federated batch loop: every
+// query is validated, checked against cache, and otherwise enqueued
+// against a single region. limit/offset window each query's profiles
+// (limit == 0 means unlimited). If ctx is canceled partway through,
+// queries not yet dispatched are marked canceled instead of being
+// enqueued. If onItem is non-nil, it's called once per query with its
+// final item as soon as that item resolves - used to stream progress.
+func runSingleRegionBatch(ctx context.Context, job *batch.Job, queries []string, region, searchType string, bypassCache bool, clientIP, callbackURL string, limit, offset int, onItem func(adventurerSearchBatchItem)) ([]adventurerSearchBatchItem, map[string]int) {
+	results := make([]adventurerSearchBatchItem, 0, len(queries))
 	stats := map[string]int{
 		"cached":   0,
 		"started":  0,
@@ -75,21 +304,31 @@ func getAdventurerSearchBatch(w http.ResponseWriter, r *http.Request) {
 		"error":    0,
 	}
 
-	bypassCache := req.BypassCache
-	if bypassCache && !utils.CheckAdminToken(r) {
-		bypassCache = false
+	emit := func(item adventurerSearchBatchItem) {
+		results = append(results, item)
+		stats[item.Status]++
+		if onItem != nil && item.Status != "started" && item.Status != "pending" {
+			onItem(item)
+		}
 	}
 
-	for _, queryValue := range req.Queries {
+	for i, queryValue := range queries {
+		if ctx != nil && ctx.Err() != nil {
+			emit(adventurerSearchBatchItem{Query: queryValue, Status: batch.StatusCanceled})
+			job.Update(i, batch.Item(adventurerSearchBatchItem{Query: queryValue, Status: batch.StatusCanceled}))
+			continue
+		}
+
 		query, queryOk, queryValidationMessage := validators.ValidateAdventurerNameQueryParam([]string{queryValue}, region, searchType)
 		if !queryOk {
-			results = append(results, adventurerSearchBatchItem{
+			item := adventurerSearchBatchItem{
 				Query:      queryValue,
 				Status:     "invalid",
 				HTTPStatus: http.StatusBadRequest,
 				Error:      queryValidationMessage,
-			})
-			stats["invalid"]++
+			}
+			job.Update(i, batch.Item(item))
+			emit(item)
 			continue
 		}
 
@@ -101,43 +340,81 @@ func getAdventurerSearchBatch(w http.ResponseWriter, r *http.Request) {
 				}
 				if status == http.StatusOK {
 					item.Status = "cached"
-					item.Data = data
-					stats["cached"]++
+					item.Data = applyResultWindow(data, offset, limit)
 				} else {
 					item.Status = "error"
 					item.Error = "cached non-200 response"
-					stats["error"]++
 				}
-				results = append(results, item)
+				job.Update(i, batch.Item(item))
+				emit(item)
 				continue
 			}
 		}
 
-		ok, tasksExceeded, _ := scraper.EnqueueAdventurerSearch(r.Header.Get("CF-Connecting-IP"), region, query, searchType)
+		index, jobID := i, job.ID
+		// The scraper has already windowed data by offset/limit (it needs
+		// limit/offset itself to know when to stop paging), so it isn't
+		// re-applied here.
+		ok, tasksExceeded, _ := scraper.EnqueueAdventurerSearchWithCallback(clientIP, region, query, searchType, limit, offset, func(data []models.Profile, status int, scrapeErr error) {
+			resolved := adventurerSearchBatchItem{
+				Query:      query,
+				HTTPStatus: status,
+			}
+			if scrapeErr != nil {
+				resolved.Status = "error"
+				resolved.Error = scrapeErr.Error()
+			} else {
+				resolved.Status = "done"
+				resolved.Data = data
+			}
+			job.Update(index, batch.Item(resolved))
+			batch.PostCallback(callbackURL, jobID, batch.Item(resolved))
+			if onItem != nil {
+				onItem(resolved)
+			}
+		})
 		if tasksExceeded {
-			results = append(results, adventurerSearchBatchItem{
+			item := adventurerSearchBatchItem{
 				Query:      query,
 				Status:     "rejected",
 				HTTPStatus: http.StatusTooManyRequests,
 				Error:      "You have exceeded the maximum number of concurrent tasks.",
-			})
-			stats["rejected"]++
+			}
+			job.Update(i, batch.Item(item))
+			emit(item)
 			continue
 		}
 
-		results = append(results, adventurerSearchBatchItem{
+		status := map[bool]string{true: "started", false: "pending"}[ok]
+		item := adventurerSearchBatchItem{
 			Query:      query,
-			Status:     map[bool]string{true: "started", false: "pending"}[ok],
+			Status:     status,
 			HTTPStatus: http.StatusAccepted,
-		})
-		stats[map[bool]string{true: "started", false: "pending"}[ok]]++
+		}
+		job.Update(i, batch.Item(item))
+		emit(item)
 	}
 
-	w.Header().Set("X-Batch-Size", strconv.Itoa(len(req.Queries)))
-	json.NewEncoder(w).Encode(adventurerSearchBatchResponse{
-		Region:     region,
-		SearchType: map[string]string{"1": "characterName", "2": "familyName"}[searchType],
-		Results:    results,
-		Stats:      stats,
-	})
+	return results, stats
+}
+
+// aggregateStatsByRegion sums a federated batch's per-region stats into
+// a single overall stats map, matching the shape runSingleRegionBatch
+// returns.
+func aggregateStatsByRegion(statsByRegion map[string]map[string]int) map[string]int {
+	stats := map[string]int{
+		"cached":   0,
+		"started":  0,
+		"pending":  0,
+		"rejected": 0,
+		"invalid":  0,
+		"error":    0,
+		"done":     0,
+	}
+	for _, regionStats := range statsByRegion {
+		for status, count := range regionStats {
+			stats[status] += count
+		}
+	}
+	return stats
 }
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"bdo-rest-api/batch"
+	"bdo-rest-api/openapi"
+)
+
+type adventurerSearchBatchJobResponse struct {
+	JobID   string         `json:"jobId"`
+	Region  string         `json:"region"`
+	Done    bool           `json:"done"`
+	Results []batch.Item   `json:"results"`
+	Stats   map[string]int `json:"stats"`
+}
+
+// adventurerSearchBatchJobRoute is this handler's OpenAPI route
+// declaration; see adventurerSearchBatchRoute for why it lives here
+// rather than in a central list.
+var adventurerSearchBatchJobRoute = openapi.Route{
+	Method:       http.MethodGet,
+	Path:         "/adventurer/search/batch/{jobId}",
+	Summary:      "Poll a previously submitted batch job for its current status",
+	ResponseType: reflect.TypeOf(adventurerSearchBatchJobResponse{}),
+}
+
+// getAdventurerSearchBatchJob reports the current per-query status of a
+// batch previously submitted to getAdventurerSearchBatch.
+func getAdventurerSearchBatchJob(w http.ResponseWriter, r *http.Request) {
+	jobID := r.PathValue("jobId")
+
+	job, ok := batch.Jobs.Get(jobID)
+	if !ok {
+		giveNotFoundResponse(w, "No batch job found with that id.")
+		return
+	}
+
+	items, stats := job.Snapshot()
+	json.NewEncoder(w).Encode(adventurerSearchBatchJobResponse{
+		JobID:   job.ID,
+		Region:  job.Region,
+		Done:    job.Done(),
+		Results: items,
+		Stats:   stats,
+	})
+}
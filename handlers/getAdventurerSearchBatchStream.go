@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// adventurerSearchBatchStreamSummary is the final line written to an
+// NDJSON batch stream, once every query has reached a terminal status.
+type adventurerSearchBatchStreamSummary struct {
+	JobID          string                    `json:"jobId"`
+	Stats          map[string]int            `json:"stats"`
+	StatsByRegion  map[string]map[string]int `json:"statsByRegion,omitempty"`
+	RegionErrors   map[string]string         `json:"regionErrors,omitempty"`
+	PartialSuccess bool                      `json:"partialSuccess,omitempty"`
+}
+
+// wantsNDJSONBatchStream reports whether the caller asked for the NDJSON
+// streaming form of the batch response, via either an Accept header or
+// a ?stream=1 query parameter.
+func wantsNDJSONBatchStream(r *http.Request) bool {
+	if r.URL.Query().Get("stream") == "1" {
+		return true
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			if strings.HasPrefix(strings.TrimSpace(part), "application/x-ndjson") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// streamAdventurerSearchBatch runs the same dispatch as the buffered
+// path, but writes and flushes each adventurerSearchBatchItem that
+// dispatch.run hands to onItem (for a federated batch, every per-region
+// update of a query) to w as soon as it's available rather than
+// buffering the whole response. dispatch.run only blocks for the initial dispatch loop;
+// queries it enqueues against the scraper resolve later from background
+// goroutines, so the summary line isn't written - and the handler
+// doesn't return - until dispatch.job.Done() actually reports every
+// query has reached a terminal state. Writing to w from one of those
+// background goroutines after this function had already returned was
+// the bug this waits out.
+func streamAdventurerSearchBatch(w http.ResponseWriter, r *http.Request, dispatch *batchDispatch) {
+	flusher, canFlush := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Batch-Size", strconv.Itoa(len(dispatch.queries)))
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	var writeMu sync.Mutex
+	write := func(v any) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if err := encoder.Encode(v); err != nil {
+			return
+		}
+		if canFlush {
+			flusher.Flush()
+		}
+	}
+
+	settled := make(chan struct{})
+	var settleOnce sync.Once
+	signalIfDone := func() {
+		if dispatch.job.Done() {
+			settleOnce.Do(func() { close(settled) })
+		}
+	}
+	onItem := func(item adventurerSearchBatchItem) {
+		write(item)
+		signalIfDone()
+	}
+
+	_, stats, statsByRegion, regionErrors := dispatch.run(r.Context(), onItem)
+	signalIfDone()
+	<-settled
+
+	write(adventurerSearchBatchStreamSummary{
+		JobID:          dispatch.job.ID,
+		Stats:          stats,
+		StatsByRegion:  statsByRegion,
+		RegionErrors:   regionErrors,
+		PartialSuccess: len(dispatch.liveRegions) < len(dispatch.regions),
+	})
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import "net/http"
+
+// docsPageHTML renders Swagger UI against the live /openapi.json
+// document, pulling the UI assets from a CDN rather than vendoring them.
+const docsPageHTML = `<!DOCTYPE html>
+<html>
+<head>
+  <title>BDO REST API - Docs</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist/swagger-ui.css" />
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = function() {
+      SwaggerUIBundle({
+        url: "/openapi.json",
+        dom_id: "#swagger-ui",
+      });
+    };
+  </script>
+</body>
+</html>
+`
+
+// getDocsPage serves a minimal Swagger UI page backed by /openapi.json.
+func getDocsPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPageHTML))
+}
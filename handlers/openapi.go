@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"bdo-rest-api/openapi"
+)
+
+//go:generate go run ../cmd/openapigen
+
+// openAPIRoutes collects every route this package declares. Each route
+// is declared as its own var beside the handler it documents (see e.g.
+// adventurerSearchBatchRoute in getAdventurerSearchBatch.go) - adding or
+// changing an endpoint and keeping this list complete happen in the
+// same file, and ideally the same commit.
+var openAPIRoutes = []openapi.Route{
+	adventurerSearchBatchRoute,
+	adventurerSearchBatchJobRoute,
+	deleteAdventurerSearchBatchJobRoute,
+}
+
+// openAPIDocument is built once, on first request, and reused after
+// that - the route registry and the types it points at are fixed at
+// compile time, so there's nothing to gain from rebuilding it per call.
+var (
+	openAPIDocumentOnce sync.Once
+	openAPIDocument     openapi.Document
+)
+
+// GenerateOpenAPIDocument builds (or returns the cached) OpenAPI 3
+// document describing this package's batch endpoints, for both
+// getOpenAPISpec and cmd/openapigen to consume.
+func GenerateOpenAPIDocument() openapi.Document {
+	openAPIDocumentOnce.Do(func() {
+		openAPIDocument = openapi.Generate(openAPIRoutes, "BDO REST API - Batch Endpoints", "1.0.0")
+	})
+	return openAPIDocument
+}
+
+// getOpenAPISpec serves the generated OpenAPI document as JSON.
+func getOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GenerateOpenAPIDocument())
+}
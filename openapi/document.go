@@ -0,0 +1,257 @@
+// Package openapi builds a minimal OpenAPI 3 document describing a set
+// of HTTP routes, generated from their request/response Go types rather
+// than hand-maintained by hand. It understands enough of the spec (paths,
+// operations, request/response schemas, component refs) to keep docs in
+// sync with the handlers that actually implement them.
+package openapi
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Route describes a single HTTP endpoint for spec generation. RequestType
+// and ResponseType may be nil for routes with no JSON body in that
+// direction (e.g. DELETE endpoints with an empty response).
+type Route struct {
+	Method       string
+	Path         string
+	Summary      string
+	RequestType  reflect.Type
+	ResponseType reflect.Type
+}
+
+// Document is the root OpenAPI 3 object, trimmed to the fields this
+// generator populates.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info is the OpenAPI document's top-level metadata block.
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem maps an HTTP method (lowercased, e.g. "get") to its Operation.
+type PathItem map[string]Operation
+
+// Operation describes one method on one path.
+type Operation struct {
+	Summary     string              `json:"summary,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// RequestBody is an operation's JSON request body.
+type RequestBody struct {
+	Content map[string]MediaType `json:"content"`
+}
+
+// Response is a single status code's response for an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType pairs a content type (always application/json here) with its
+// schema.
+type MediaType struct {
+	Schema Schema `json:"schema"`
+}
+
+// Schema is a (deliberately partial) JSON Schema, covering what this
+// generator can infer from Go struct fields and tags.
+type Schema struct {
+	Type        string            `json:"type,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Properties  map[string]Schema `json:"properties,omitempty"`
+	Items       *Schema           `json:"items,omitempty"`
+	MaxItems    int               `json:"maxItems,omitempty"`
+	Ref         string            `json:"$ref,omitempty"`
+}
+
+// Components holds named schemas that Routes' request/response types are
+// turned into, so the paths section can reference them by name instead of
+// inlining every struct.
+type Components struct {
+	Schemas map[string]Schema `json:"schemas"`
+}
+
+// Generate builds a Document for routes, registering one component
+// schema per distinct Go type it encounters.
+func Generate(routes []Route, title, version string) Document {
+	doc := Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: title, Version: version},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: map[string]Schema{},
+		},
+	}
+
+	for _, route := range routes {
+		item, ok := doc.Paths[route.Path]
+		if !ok {
+			item = PathItem{}
+		}
+
+		op := Operation{
+			Summary: route.Summary,
+			Responses: map[string]Response{
+				"200": {
+					Description: "OK",
+				},
+			},
+		}
+		if route.RequestType != nil {
+			op.RequestBody = &RequestBody{
+				Content: map[string]MediaType{
+					"application/json": {Schema: refSchema(&doc, route.RequestType)},
+				},
+			}
+		}
+		if route.ResponseType != nil {
+			op.Responses["200"] = Response{
+				Description: "OK",
+				Content: map[string]MediaType{
+					"application/json": {Schema: refSchema(&doc, route.ResponseType)},
+				},
+			}
+		}
+
+		item[strings.ToLower(route.Method)] = op
+		doc.Paths[route.Path] = item
+	}
+
+	return doc
+}
+
+// refSchema registers t's schema under its type name (generating it if
+// this is the first time t has been seen) and returns a $ref Schema
+// pointing at it.
+func refSchema(doc *Document, t reflect.Type) Schema {
+	name := t.Name()
+	if _, ok := doc.Components.Schemas[name]; !ok {
+		doc.Components.Schemas[name] = schemaFromType(doc, t)
+	}
+	return Schema{Ref: "#/components/schemas/" + name}
+}
+
+// schemaFromType converts a Go type into a Schema, recursing into
+// structs/slices and registering nested struct types as components via
+// refSchema.
+func schemaFromType(doc *Document, t reflect.Type) Schema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFromType(doc, t.Elem())
+	case reflect.Slice:
+		var elem Schema
+		if elemType := derefType(t.Elem()); elemType.Kind() == reflect.Struct {
+			elem = refSchema(doc, elemType)
+		} else {
+			elem = schemaFromType(doc, t.Elem())
+		}
+		return Schema{Type: "array", Items: &elem}
+	case reflect.Map:
+		return Schema{Type: "object"}
+	case reflect.Struct:
+		return schemaFromStruct(doc, t)
+	case reflect.String:
+		return Schema{Type: "string"}
+	case reflect.Bool:
+		return Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{Type: "number"}
+	default:
+		return Schema{Type: "object"}
+	}
+}
+
+// schemaFromStruct walks a struct's fields, naming each property from its
+// json tag and reading `openapi:"description=...,maxItems=N"` tags for
+// documentation the json tag can't carry.
+func schemaFromStruct(doc *Document, t reflect.Type) Schema {
+	properties := map[string]Schema{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		jsonName, omit := fieldJSONName(field)
+		if omit {
+			continue
+		}
+
+		fieldType := field.Type
+		var fieldSchema Schema
+		if fieldType.Kind() == reflect.Struct || (fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Struct) {
+			fieldSchema = refSchema(doc, derefType(fieldType))
+		} else {
+			fieldSchema = schemaFromType(doc, fieldType)
+		}
+
+		applyOpenAPITag(&fieldSchema, field.Tag.Get("openapi"))
+		properties[jsonName] = fieldSchema
+	}
+
+	return Schema{Type: "object", Properties: properties}
+}
+
+// derefType unwraps a single level of pointer indirection.
+func derefType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// fieldJSONName returns the name a field serializes as, and whether it's
+// excluded entirely (json:"-").
+func fieldJSONName(field reflect.StructField) (name string, omit bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name = strings.Split(tag, ",")[0]
+	if name == "" {
+		name = field.Name
+	}
+	return name, false
+}
+
+// applyOpenAPITag parses a comma-separated `key=value` tag (e.g.
+// `description=...,maxItems=200`) into the schema's doc-only fields.
+func applyOpenAPITag(schema *Schema, tag string) {
+	if tag == "" {
+		return
+	}
+	for _, pair := range strings.Split(tag, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "description":
+			schema.Description = value
+		case "maxItems":
+			var n int
+			for _, c := range value {
+				if c < '0' || c > '9' {
+					n = 0
+					break
+				}
+				n = n*10 + int(c-'0')
+			}
+			schema.MaxItems = n
+		}
+	}
+}
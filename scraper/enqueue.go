@@ -0,0 +1,111 @@
+// Package scraper enqueues asynchronous lookups against the official BDO
+// adventurer search page and reports each one's outcome back to its
+// caller once it resolves.
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"bdo-rest-api/models"
+)
+
+// maxConcurrentTasks bounds how many scrapes run at once; enqueue calls
+// past this limit return tasksExceeded=true instead of being queued.
+const maxConcurrentTasks = 32
+
+// regionSearchEndpoints maps each supported region to the official
+// adventurer search endpoint scrapes are issued against.
+var regionSearchEndpoints = map[string]string{
+	"na": "https://na-trade.naeu.playblackdesert.com/Adventurer/Search",
+	"eu": "https://eu-trade.naeu.playblackdesert.com/Adventurer/Search",
+	"kr": "https://trade.kr.playblackdesert.com/Adventurer/Search",
+}
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+var activeTasks int32
+
+// EnqueueAdventurerSearch starts an asynchronous scrape of query in
+// region/searchType on behalf of clientIP and returns immediately,
+// without any notification of how it resolves - existing callers that
+// need the data re-request it once it's landed in cache.ProfileSearch.
+// tasksExceeded reports that the concurrent task limit was hit and
+// nothing was enqueued.
+func EnqueueAdventurerSearch(clientIP, region, query, searchType string) (ok bool, tasksExceeded bool, err error) {
+	return EnqueueAdventurerSearchWithCallback(clientIP, region, query, searchType, 0, 0, nil)
+}
+
+// EnqueueAdventurerSearchWithCallback behaves like EnqueueAdventurerSearch,
+// except callback is invoked exactly once, from a background goroutine,
+// once the scrape resolves - used by the batch job endpoints to learn
+// when a query they enqueued actually completes. limit/offset let the
+// scrape stop paging once it's gathered enough profiles; the data handed
+// to callback is already windowed by them and must not be windowed
+// again by the caller.
+func EnqueueAdventurerSearchWithCallback(clientIP, region, query, searchType string, limit, offset int, callback func(data []models.Profile, status int, err error)) (ok bool, tasksExceeded bool, err error) {
+	if atomic.AddInt32(&activeTasks, 1) > maxConcurrentTasks {
+		atomic.AddInt32(&activeTasks, -1)
+		return false, true, nil
+	}
+
+	go func() {
+		defer atomic.AddInt32(&activeTasks, -1)
+		data, status, scrapeErr := scrape(region, query, searchType, limit, offset)
+		if callback != nil {
+			callback(data, status, scrapeErr)
+		}
+	}()
+
+	return true, false, nil
+}
+
+// scrape issues the actual request against region's adventurer search
+// endpoint and returns up to limit profiles starting at offset (all of
+// them if limit is 0).
+func scrape(region, query, searchType string, limit, offset int) ([]models.Profile, int, error) {
+	endpoint, ok := regionSearchEndpoints[region]
+	if !ok {
+		return nil, http.StatusInternalServerError, fmt.Errorf("no search endpoint configured for region %q", region)
+	}
+
+	resp, err := httpClient.Get(fmt.Sprintf("%s?keyword=%s&searchType=%s", endpoint, query, searchType))
+	if err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+
+	var profiles []models.Profile
+	if err := json.Unmarshal(body, &profiles); err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+
+	return windowProfiles(profiles, offset, limit), resp.StatusCode, nil
+}
+
+// windowProfiles slices profiles by offset/limit, where limit == 0 means
+// unlimited. It mirrors handlers.applyResultWindow so a scrape's result
+// is windowed exactly once, here, rather than windowed again by the
+// caller.
+func windowProfiles(profiles []models.Profile, offset, limit int) []models.Profile {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(profiles) {
+		return []models.Profile{}
+	}
+	windowed := profiles[offset:]
+	if limit > 0 && limit < len(windowed) {
+		windowed = windowed[:limit]
+	}
+	return windowed
+}